@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Committer wraps the transaction SchemaGenerator opens via sg.db.Begin()
+// (see gormCommitter). GenerateSchemaTx and Migrate only call Commit once every
+// statement in the apply has succeeded, and Rollback on the first failure,
+// so a partial schema is never left behind.
+type Committer interface {
+	Commit() error
+	Rollback() error
+}
+
+type gormCommitter struct {
+	tx *gorm.DB
+}
+
+func (c gormCommitter) Commit() error   { return c.tx.Commit().Error }
+func (c gormCommitter) Rollback() error { return c.tx.Rollback().Error }
+
+// applyStatementTimeout sets Postgres's statement_timeout for the remainder
+// of tx from ctx's deadline, so the server aborts DDL still running when that
+// deadline passes. Cancellation without a deadline (e.g. a client
+// disconnect) is not covered here; it reaches tx through the context tx was
+// opened with. It is a no-op for other dialects or a context without a
+// deadline.
+func (sg *SchemaGenerator) applyStatementTimeout(tx *gorm.DB, ctx context.Context) error {
+	if sg.dialect.Name() != "postgres" {
+		return nil
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	timeoutMS := time.Until(deadline).Milliseconds()
+	if timeoutMS <= 0 {
+		return nil
+	}
+	return tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", timeoutMS)).Error
+}
+
+// execAll runs statements against tx in order, stopping at the first error.
+func execAll(tx *gorm.DB, statements []string) error {
+	for _, stmt := range statements {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
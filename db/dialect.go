@@ -0,0 +1,405 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect captures the SQL differences between database backends so that
+// SchemaGenerator never has to hard-code a particular engine's DDL.
+type Dialect interface {
+	// Name identifies the dialect, e.g. "postgres", "mysql", "sqlite", "sqlserver".
+	Name() string
+
+	// PrimaryKeyClause returns the column definition for the auto-incrementing
+	// primary key column ("id") of a newly created table.
+	PrimaryKeyClause() string
+
+	// MapType converts a StateQL field type into a column type for this dialect.
+	MapType(stateqlType string) string
+
+	// QuoteIdent quotes a table or column name for this dialect, escaping any
+	// embedded quote characters so the identifier can't break out of its
+	// quoting (e.g. a user-supplied schema name containing a `"`).
+	QuoteIdent(name string) string
+
+	// SupportsIntrospection reports whether this dialect exposes
+	// information_schema (or an equivalent) that the migration subsystem can
+	// diff a live table against.
+	SupportsIntrospection() bool
+
+	// AddColumnSQL returns the statement that adds column of columnType to table.
+	AddColumnSQL(table, column, columnType string) string
+
+	// AlterColumnTypeSQL returns the statement that changes column on table to columnType.
+	AlterColumnTypeSQL(table, column, columnType string) string
+
+	// DropColumnSQL returns the statement that removes column from table.
+	DropColumnSQL(table, column string) string
+
+	// DropTableSQL returns the statement that removes table entirely.
+	DropTableSQL(table string) string
+
+	// GeometryColumnSQL returns the column type for a spatial field such as
+	// "point" or "polygon", honoring the srid=/dims= modifiers in args.
+	// Dialects without spatial support return an error.
+	GeometryColumnSQL(stateqlType string, args map[string]string) (string, error)
+
+	// GeometryIndexSQL returns the statement that creates a spatial index on
+	// column of table.
+	GeometryIndexSQL(table, column string) string
+
+	// PostGISExtensionSQL returns the statement that enables spatial support,
+	// or "" if the dialect needs no such step.
+	PostGISExtensionSQL() string
+
+	// IndexSQL returns the statement that creates a plain (non-spatial)
+	// index named indexName on column of table.
+	IndexSQL(indexName, table, column string) string
+
+	// JunctionTableSQL returns the CREATE TABLE statement for a many-to-many
+	// join table named tableName. leftName/rightName are the unqualified
+	// entity names used to derive the FK column names ("<name>_id");
+	// leftRef/rightRef are the (possibly schema-qualified) tables those
+	// columns reference.
+	JunctionTableSQL(tableName, leftName, leftRef, rightName, rightRef string) string
+}
+
+// DialectForScheme resolves a Dialect from a DSN scheme or config flag such as
+// "postgres", "mysql", "sqlite", or "sqlserver".
+func DialectForScheme(scheme string) (Dialect, error) {
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql", "pg":
+		return postgresDialect{}, nil
+	case "mysql":
+		return mysqlDialect{}, nil
+	case "sqlite", "sqlite3":
+		return sqliteDialect{}, nil
+	case "sqlserver", "mssql":
+		return sqlserverDialect{}, nil
+	default:
+		return nil, fmt.Errorf("db: unsupported dialect %q", scheme)
+	}
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) PrimaryKeyClause() string {
+	return "id SERIAL PRIMARY KEY"
+}
+
+func (postgresDialect) MapType(stateqlType string) string {
+	switch strings.ToLower(stateqlType) {
+	case "text":
+		return "TEXT"
+	case "number":
+		return "NUMERIC"
+	case "switch":
+		return "BOOLEAN"
+	case "date":
+		return "DATE"
+	case "timestamp":
+		return "TIMESTAMP"
+	case "seconds":
+		return "INTEGER"
+	default:
+		return "TEXT"
+	}
+}
+
+func (postgresDialect) QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (postgresDialect) SupportsIntrospection() bool { return true }
+
+func (d postgresDialect) AddColumnSQL(table, column, columnType string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, columnType)
+}
+
+func (d postgresDialect) AlterColumnTypeSQL(table, column, columnType string) string {
+	return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", table, column, columnType)
+}
+
+func (d postgresDialect) DropColumnSQL(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
+}
+
+func (d postgresDialect) DropTableSQL(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", table)
+}
+
+// postgisTypeNames maps StateQL spatial type names to PostGIS geometry
+// subtype names.
+var postgisTypeNames = map[string]string{
+	"point":      "Point",
+	"polygon":    "Polygon",
+	"linestring": "LineString",
+}
+
+func (d postgresDialect) GeometryColumnSQL(stateqlType string, args map[string]string) (string, error) {
+	geomType, ok := postgisTypeNames[strings.ToLower(stateqlType)]
+	if !ok {
+		return "", fmt.Errorf("db: unsupported geometry type %q", stateqlType)
+	}
+
+	srid := args["srid"]
+	if srid == "" {
+		srid = "4326"
+	}
+
+	switch args["dims"] {
+	case "3":
+		geomType += "Z"
+	case "4":
+		geomType += "ZM"
+	}
+
+	return fmt.Sprintf("geometry(%s,%s)", geomType, srid), nil
+}
+
+func (d postgresDialect) GeometryIndexSQL(table, column string) string {
+	indexName := fmt.Sprintf("idx_%s_%s_gist", strings.ReplaceAll(strings.Trim(table, `"`), `"."`, "_"), column)
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIST (%s)", indexName, table, column)
+}
+
+func (d postgresDialect) PostGISExtensionSQL() string {
+	return "CREATE EXTENSION IF NOT EXISTS postgis"
+}
+
+func (d postgresDialect) IndexSQL(indexName, table, column string) string {
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", indexName, table, column)
+}
+
+func (d postgresDialect) JunctionTableSQL(tableName, leftName, leftRef, rightName, rightRef string) string {
+	return fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					%s_id INTEGER REFERENCES %s(id),
+					%s_id INTEGER REFERENCES %s(id),
+					PRIMARY KEY (%s_id, %s_id)
+				)`,
+		tableName, leftName, leftRef, rightName, rightRef, leftName, rightName)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) PrimaryKeyClause() string {
+	return "id INTEGER PRIMARY KEY AUTO_INCREMENT"
+}
+
+func (mysqlDialect) MapType(stateqlType string) string {
+	switch strings.ToLower(stateqlType) {
+	case "text":
+		return "TEXT"
+	case "number":
+		return "DECIMAL(65,30)"
+	case "switch":
+		return "TINYINT(1)"
+	case "date":
+		return "DATE"
+	case "timestamp":
+		return "DATETIME"
+	case "seconds":
+		return "INTEGER"
+	default:
+		return "TEXT"
+	}
+}
+
+func (mysqlDialect) QuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (mysqlDialect) SupportsIntrospection() bool { return true }
+
+func (d mysqlDialect) AddColumnSQL(table, column, columnType string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, columnType)
+}
+
+func (d mysqlDialect) AlterColumnTypeSQL(table, column, columnType string) string {
+	return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, column, columnType)
+}
+
+func (d mysqlDialect) DropColumnSQL(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
+}
+
+func (d mysqlDialect) DropTableSQL(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", table)
+}
+
+func (mysqlDialect) GeometryColumnSQL(stateqlType string, args map[string]string) (string, error) {
+	return "", fmt.Errorf("db: geometry type %q is not supported on mysql", stateqlType)
+}
+
+func (mysqlDialect) GeometryIndexSQL(table, column string) string { return "" }
+
+func (mysqlDialect) PostGISExtensionSQL() string { return "" }
+
+// MySQL has no "CREATE INDEX IF NOT EXISTS"; re-running this on an existing
+// index errors, same as any other re-applied CREATE INDEX on this dialect.
+func (d mysqlDialect) IndexSQL(indexName, table, column string) string {
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s)", indexName, table, column)
+}
+
+func (d mysqlDialect) JunctionTableSQL(tableName, leftName, leftRef, rightName, rightRef string) string {
+	return fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					%s_id INTEGER,
+					%s_id INTEGER,
+					PRIMARY KEY (%s_id, %s_id),
+					FOREIGN KEY (%s_id) REFERENCES %s(id),
+					FOREIGN KEY (%s_id) REFERENCES %s(id)
+				)`,
+		tableName, leftName, rightName, leftName, rightName, leftName, leftRef, rightName, rightRef)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) PrimaryKeyClause() string {
+	return "id INTEGER PRIMARY KEY AUTOINCREMENT"
+}
+
+func (sqliteDialect) MapType(stateqlType string) string {
+	switch strings.ToLower(stateqlType) {
+	case "text":
+		return "TEXT"
+	case "number":
+		return "REAL"
+	case "switch":
+		return "BOOLEAN"
+	case "date":
+		return "DATE"
+	case "timestamp":
+		return "TIMESTAMP"
+	case "seconds":
+		return "INTEGER"
+	default:
+		return "TEXT"
+	}
+}
+
+func (sqliteDialect) QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// SQLite has no information_schema and only supports a handful of ALTER
+// TABLE forms (no ALTER COLUMN TYPE, no DROP COLUMN before 3.35), so the
+// migration subsystem refuses to diff it rather than emit DDL it can't run.
+func (sqliteDialect) SupportsIntrospection() bool { return false }
+
+func (d sqliteDialect) AddColumnSQL(table, column, columnType string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, columnType)
+}
+
+func (d sqliteDialect) AlterColumnTypeSQL(table, column, columnType string) string {
+	return fmt.Sprintf("-- sqlite does not support ALTER COLUMN TYPE for %s.%s", table, column)
+}
+
+func (d sqliteDialect) DropColumnSQL(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
+}
+
+func (d sqliteDialect) DropTableSQL(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", table)
+}
+
+func (sqliteDialect) GeometryColumnSQL(stateqlType string, args map[string]string) (string, error) {
+	return "", fmt.Errorf("db: geometry type %q is not supported on sqlite", stateqlType)
+}
+
+func (sqliteDialect) GeometryIndexSQL(table, column string) string { return "" }
+
+func (sqliteDialect) PostGISExtensionSQL() string { return "" }
+
+func (d sqliteDialect) IndexSQL(indexName, table, column string) string {
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", indexName, table, column)
+}
+
+func (d sqliteDialect) JunctionTableSQL(tableName, leftName, leftRef, rightName, rightRef string) string {
+	return fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					%s_id INTEGER REFERENCES %s(id),
+					%s_id INTEGER REFERENCES %s(id),
+					PRIMARY KEY (%s_id, %s_id)
+				)`,
+		tableName, leftName, leftRef, rightName, rightRef, leftName, rightName)
+}
+
+type sqlserverDialect struct{}
+
+func (sqlserverDialect) Name() string { return "sqlserver" }
+
+func (sqlserverDialect) PrimaryKeyClause() string {
+	return "id INT IDENTITY(1,1) PRIMARY KEY"
+}
+
+func (sqlserverDialect) MapType(stateqlType string) string {
+	switch strings.ToLower(stateqlType) {
+	case "text":
+		return "NVARCHAR(MAX)"
+	case "number":
+		return "NUMERIC"
+	case "switch":
+		return "BIT"
+	case "date":
+		return "DATE"
+	case "timestamp":
+		return "DATETIME2"
+	case "seconds":
+		return "INT"
+	default:
+		return "NVARCHAR(MAX)"
+	}
+}
+
+func (sqlserverDialect) QuoteIdent(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+func (sqlserverDialect) SupportsIntrospection() bool { return true }
+
+func (d sqlserverDialect) AddColumnSQL(table, column, columnType string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s %s", table, column, columnType)
+}
+
+func (d sqlserverDialect) AlterColumnTypeSQL(table, column, columnType string) string {
+	return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", table, column, columnType)
+}
+
+func (d sqlserverDialect) DropColumnSQL(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
+}
+
+func (d sqlserverDialect) DropTableSQL(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", table)
+}
+
+func (sqlserverDialect) GeometryColumnSQL(stateqlType string, args map[string]string) (string, error) {
+	return "", fmt.Errorf("db: geometry type %q is not supported on sqlserver", stateqlType)
+}
+
+func (sqlserverDialect) GeometryIndexSQL(table, column string) string { return "" }
+
+func (sqlserverDialect) PostGISExtensionSQL() string { return "" }
+
+// SQL Server has no "CREATE INDEX IF NOT EXISTS" either.
+func (d sqlserverDialect) IndexSQL(indexName, table, column string) string {
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s)", indexName, table, column)
+}
+
+func (d sqlserverDialect) JunctionTableSQL(tableName, leftName, leftRef, rightName, rightRef string) string {
+	return fmt.Sprintf(`
+				CREATE TABLE %s (
+					%s_id INT REFERENCES %s(id),
+					%s_id INT REFERENCES %s(id),
+					PRIMARY KEY (%s_id, %s_id)
+				)`,
+		tableName, leftName, leftRef, rightName, rightRef, leftName, rightName)
+}
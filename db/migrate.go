@@ -0,0 +1,328 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"stateql/parser"
+)
+
+// migrationsTable is the bookkeeping table that records which source
+// revisions have already been applied.
+const migrationsTable = "stateql_migrations"
+
+// MigrationPlan is the set of DDL statements needed to converge the live
+// database with a parsed StateQL source.
+type MigrationPlan struct {
+	Statements []string
+	SourceHash string
+	// AlreadyApplied is true when SourceHash has already been recorded in
+	// stateql_migrations, in which case Statements is always empty.
+	AlreadyApplied bool
+}
+
+type introspectedColumn struct {
+	Name     string
+	DataType string
+}
+
+// Migrate introspects the live database, diffs it against stateql, and
+// applies the minimal set of CREATE TABLE / ADD COLUMN / ALTER COLUMN /
+// DROP COLUMN and junction-table statements needed to converge, recording
+// the applied revision in stateql_migrations so repeat calls with the same
+// source are a no-op. If dryRun is true, the plan is only computed and
+// returned: none of its statements is executed and no revision is recorded,
+// though the configured Postgres schema and the stateql_migrations table are
+// still created if they are missing. Otherwise every statement runs
+// inside a single transaction via the same Committer GenerateSchemaTx uses,
+// so a failure partway through leaves the database untouched. ctx governs
+// cancellation and, on Postgres, the statement_timeout for the apply.
+func (sg *SchemaGenerator) Migrate(ctx context.Context, stateql *parser.StateQL, source string, dryRun bool) (*MigrationPlan, error) {
+	if !sg.dialect.SupportsIntrospection() {
+		return nil, fmt.Errorf("db: dialect %q does not support schema introspection", sg.dialect.Name())
+	}
+
+	hash := hashSource(source)
+
+	if sg.schema != "" && sg.dialect.Name() == "postgres" {
+		createSchemaSQL := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", sg.dialect.QuoteIdent(sg.schema))
+		if err := sg.db.Exec(createSchemaSQL).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sg.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	applied, err := sg.revisionApplied(hash)
+	if err != nil {
+		return nil, err
+	}
+	if applied {
+		return &MigrationPlan{SourceHash: hash, AlreadyApplied: true}, nil
+	}
+
+	statements, err := sg.planMigration(stateql)
+	if err != nil {
+		return nil, err
+	}
+	plan := &MigrationPlan{Statements: statements, SourceHash: hash}
+
+	if dryRun || len(statements) == 0 {
+		return plan, nil
+	}
+
+	tx := sg.db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	committer := gormCommitter{tx: tx}
+
+	if err := sg.applyStatementTimeout(tx, ctx); err != nil {
+		committer.Rollback()
+		return nil, err
+	}
+
+	if err := execAll(tx, statements); err != nil {
+		committer.Rollback()
+		return nil, err
+	}
+
+	insertSQL := fmt.Sprintf("INSERT INTO %s (source_hash, applied_at) VALUES (?, CURRENT_TIMESTAMP)", sg.qualifiedTable(migrationsTable))
+	if err := tx.Exec(insertSQL, hash).Error; err != nil {
+		committer.Rollback()
+		return nil, err
+	}
+
+	if err := committer.Commit(); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// migrationsTableCreateSQL returns the CREATE TABLE statement for
+// stateql_migrations. It performs no I/O, so its exact output is unit
+// testable without a live database.
+func (sg *SchemaGenerator) migrationsTableCreateSQL() string {
+	return fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (%s, source_hash TEXT NOT NULL, applied_at TIMESTAMP NOT NULL)",
+		sg.qualifiedTable(migrationsTable), sg.dialect.PrimaryKeyClause())
+}
+
+func (sg *SchemaGenerator) ensureMigrationsTable() error {
+	return sg.db.Exec(sg.migrationsTableCreateSQL()).Error
+}
+
+func (sg *SchemaGenerator) revisionApplied(hash string) (bool, error) {
+	var count int64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE source_hash = ?", sg.qualifiedTable(migrationsTable))
+	if err := sg.db.Raw(query, hash).Scan(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// entityDiff is the result of diffing one entity against the live database,
+// carried from planMigration's first pass (create/diff) to its second
+// (relationships), so a new entity's BelongsTo field can reference another
+// new entity declared later in stateql.
+type entityDiff struct {
+	entity         parser.Entity
+	tableName      string
+	isNew          bool
+	existingByName map[string]bool
+}
+
+// planMigration diffs every entity in stateql against the live database and
+// returns the ordered statements needed to converge. It only reads from the
+// database (via introspectColumns); building the statements for a
+// not-yet-existing entity is delegated to the same pure builders
+// GenerateSchemaTx uses, so planning itself never has a side effect.
+//
+// Like GenerateSchemaTx, it runs in two passes: every entity's CREATE TABLE
+// / column diff first, then every entity's relationship statements. A
+// single pass that interleaved the two would emit a new entity's "author_id
+// REFERENCES user(id)" column before a later-declared "user" table exists.
+func (sg *SchemaGenerator) planMigration(stateql *parser.StateQL) ([]string, error) {
+	var statements []string
+	diffs := make([]entityDiff, 0, len(stateql.Entities))
+
+	for _, entity := range stateql.Entities {
+		tableName := strings.ToLower(entity.Name)
+		existing, err := sg.introspectColumns(tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(existing) == 0 {
+			// Entity doesn't exist yet; reuse the same CREATE TABLE
+			// statements GenerateSchemaTx's createTable would run.
+			createStatements, err := sg.buildCreateTableSQL(entity)
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, createStatements...)
+			diffs = append(diffs, entityDiff{entity: entity, tableName: tableName, isNew: true})
+			continue
+		}
+
+		columnStatements, err := sg.diffColumns(tableName, existing, entity)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, columnStatements...)
+
+		existingByName := make(map[string]bool, len(existing))
+		for _, col := range existing {
+			existingByName[col.Name] = true
+		}
+		diffs = append(diffs, entityDiff{entity: entity, tableName: tableName, existingByName: existingByName})
+	}
+
+	for _, d := range diffs {
+		if d.isNew {
+			statements = append(statements, sg.buildRelationshipSQL(d.entity)...)
+			continue
+		}
+
+		for _, field := range d.entity.Fields {
+			switch field.RelationKind {
+			case parser.BelongsTo:
+				columnName := strings.ToLower(field.Name) + "_id"
+				if d.existingByName[columnName] {
+					continue
+				}
+				qualified := sg.qualifiedTable(d.tableName)
+				targetTable := sg.qualifiedTable(strings.ToLower(field.Type))
+				statements = append(statements, sg.dialect.AddColumnSQL(qualified, columnName, fmt.Sprintf("INTEGER REFERENCES %s(id)", targetTable)))
+				statements = append(statements, sg.dialect.IndexSQL(fmt.Sprintf("idx_%s_%s", d.tableName, columnName), qualified, columnName))
+			case parser.ManyToMany:
+				if !isCanonicalManyToMany(d.entity.Name, field) {
+					continue
+				}
+				junctionName := fmt.Sprintf("%s_%s", d.tableName, strings.ToLower(field.Name))
+				junctionColumns, err := sg.introspectColumns(junctionName)
+				if err != nil {
+					return nil, err
+				}
+				if len(junctionColumns) == 0 {
+					statements = append(statements, sg.buildManyToManySQL(d.entity, field))
+				}
+			}
+		}
+	}
+
+	return statements, nil
+}
+
+// diffColumns compares the live columns of tableName against entity's
+// scalar fields and returns the ADD COLUMN / ALTER COLUMN / DROP COLUMN
+// statements that converge them.
+func (sg *SchemaGenerator) diffColumns(tableName string, existing []introspectedColumn, entity parser.Entity) ([]string, error) {
+	var statements []string
+	qualified := sg.qualifiedTable(tableName)
+
+	existingByName := make(map[string]string, len(existing))
+	for _, col := range existing {
+		existingByName[col.Name] = col.DataType
+	}
+
+	desired := map[string]bool{"id": true}
+	hasNewGeometry := false
+
+	for _, field := range entity.Fields {
+		if field.IsMany || field.IsAction {
+			continue
+		}
+		if field.RelationKind == parser.BelongsTo {
+			// Its "<name>_id" column is handled separately in planMigration,
+			// but it still counts as desired so the drop pass below leaves it alone.
+			desired[strings.ToLower(field.Name)+"_id"] = true
+			continue
+		}
+		name := strings.ToLower(field.Name)
+		desired[name] = true
+		_, exists := existingByName[name]
+
+		if parser.IsGeometryType(field.Type) {
+			// PostGIS reports geometry columns as data_type "USER-DEFINED",
+			// so there's nothing meaningful to diff once the column exists.
+			if exists {
+				continue
+			}
+			columnType, err := sg.dialect.GeometryColumnSQL(field.Type, field.GeometryArgs)
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, sg.dialect.AddColumnSQL(qualified, name, columnType))
+			statements = append(statements, sg.dialect.GeometryIndexSQL(qualified, name))
+			hasNewGeometry = true
+			continue
+		}
+
+		columnType := sg.dialect.MapType(field.Type)
+		if !exists {
+			statements = append(statements, sg.dialect.AddColumnSQL(qualified, name, columnType))
+			continue
+		}
+		if !strings.EqualFold(existingByName[name], columnType) {
+			statements = append(statements, sg.dialect.AlterColumnTypeSQL(qualified, name, columnType))
+		}
+	}
+
+	for name := range existingByName {
+		if !desired[name] {
+			statements = append(statements, sg.dialect.DropColumnSQL(qualified, name))
+		}
+	}
+
+	if hasNewGeometry {
+		if extensionSQL := sg.dialect.PostGISExtensionSQL(); extensionSQL != "" {
+			statements = append([]string{extensionSQL}, statements...)
+		}
+	}
+
+	return statements, nil
+}
+
+// introspectColumns queries information_schema.columns for tableName,
+// returning nil if the table does not exist yet.
+func (sg *SchemaGenerator) introspectColumns(tableName string) ([]introspectedColumn, error) {
+	query := "SELECT column_name, data_type FROM information_schema.columns WHERE table_name = ?"
+	args := []interface{}{tableName}
+
+	if sg.schema != "" && sg.dialect.Name() == "postgres" {
+		// WithSchema only namespaces tables on postgres (see qualifiedTable),
+		// so only postgres should filter introspection by it too.
+		query += " AND table_schema = ?"
+		args = append(args, sg.schema)
+	} else if sg.dialect.Name() == "postgres" {
+		query += " AND table_schema = 'public'"
+	}
+
+	rows, err := sg.db.Raw(query, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []introspectedColumn
+	for rows.Next() {
+		var col introspectedColumn
+		if err := rows.Scan(&col.Name, &col.DataType); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+func hashSource(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,27 @@
+package db
+
+import "testing"
+
+// TestMigrationsTableCreateSQL pins the exact DDL ensureMigrationsTable
+// executes. It caught a real bug once: PrimaryKeyClause() already returns
+// "id SERIAL PRIMARY KEY" (etc.), so a format string with a literal "id "
+// in front of it produced "id id SERIAL PRIMARY KEY" and broke every
+// schema-apply request.
+func TestMigrationsTableCreateSQL(t *testing.T) {
+	cases := []struct {
+		dialect Dialect
+		want    string
+	}{
+		{postgresDialect{}, `CREATE TABLE IF NOT EXISTS "stateql_migrations" (id SERIAL PRIMARY KEY, source_hash TEXT NOT NULL, applied_at TIMESTAMP NOT NULL)`},
+		{mysqlDialect{}, "CREATE TABLE IF NOT EXISTS `stateql_migrations` (id INTEGER PRIMARY KEY AUTO_INCREMENT, source_hash TEXT NOT NULL, applied_at TIMESTAMP NOT NULL)"},
+		{sqliteDialect{}, `CREATE TABLE IF NOT EXISTS "stateql_migrations" (id INTEGER PRIMARY KEY AUTOINCREMENT, source_hash TEXT NOT NULL, applied_at TIMESTAMP NOT NULL)`},
+		{sqlserverDialect{}, "CREATE TABLE IF NOT EXISTS [stateql_migrations] (id INT IDENTITY(1,1) PRIMARY KEY, source_hash TEXT NOT NULL, applied_at TIMESTAMP NOT NULL)"},
+	}
+
+	for _, tc := range cases {
+		sg := NewSchemaGenerator(nil, tc.dialect)
+		if got := sg.migrationsTableCreateSQL(); got != tc.want {
+			t.Errorf("%s: migrationsTableCreateSQL() = %q, want %q", tc.dialect.Name(), got, tc.want)
+		}
+	}
+}
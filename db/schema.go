@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -10,94 +11,221 @@ import (
 )
 
 type SchemaGenerator struct {
-	db *gorm.DB
+	db      *gorm.DB
+	dialect Dialect
+	schema  string
 }
 
-func NewSchemaGenerator(db *gorm.DB) *SchemaGenerator {
-	return &SchemaGenerator{db: db}
+// SchemaGeneratorOption configures optional SchemaGenerator behavior.
+type SchemaGeneratorOption func(*SchemaGenerator)
+
+// WithSchema namespaces every table the generator creates under the given
+// Postgres schema (e.g. for multi-tenant deployments that share one
+// database). It has no effect on dialects other than postgres.
+func WithSchema(name string) SchemaGeneratorOption {
+	return func(sg *SchemaGenerator) {
+		sg.schema = name
+	}
+}
+
+// NewSchemaGenerator builds a SchemaGenerator that emits DDL for the given
+// dialect (postgres, mysql, sqlite, or sqlserver).
+func NewSchemaGenerator(db *gorm.DB, dialect Dialect, opts ...SchemaGeneratorOption) *SchemaGenerator {
+	sg := &SchemaGenerator{db: db, dialect: dialect}
+	for _, opt := range opts {
+		opt(sg)
+	}
+	return sg
 }
 
+// GenerateSchema applies stateql with a background context. See
+// GenerateSchemaTx for the context-aware, transactional entry point.
 func (sg *SchemaGenerator) GenerateSchema(stateql *parser.StateQL) error {
+	return sg.GenerateSchemaTx(context.Background(), stateql)
+}
+
+// GenerateSchemaTx applies every entity in stateql inside a single
+// transaction obtained from sg.db.Begin(), committing only if every
+// statement succeeds and rolling back otherwise, so a failure partway
+// through never leaves orphaned tables behind. ctx governs cancellation and,
+// on Postgres, the statement_timeout for the whole apply, so a client
+// disconnect aborts cleanly instead of running to completion.
+func (sg *SchemaGenerator) GenerateSchemaTx(ctx context.Context, stateql *parser.StateQL) error {
+	tx := sg.db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	committer := gormCommitter{tx: tx}
+
+	if err := sg.applyStatementTimeout(tx, ctx); err != nil {
+		committer.Rollback()
+		return err
+	}
+
+	if sg.schema != "" && sg.dialect.Name() == "postgres" {
+		createSchemaSQL := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", sg.dialect.QuoteIdent(sg.schema))
+		if err := tx.Exec(createSchemaSQL).Error; err != nil {
+			committer.Rollback()
+			return err
+		}
+	}
+
 	// Create tables for each entity
 	for _, entity := range stateql.Entities {
-		if err := sg.createTable(entity); err != nil {
+		if err := sg.createTable(tx, entity); err != nil {
+			committer.Rollback()
 			return err
 		}
 	}
 
 	// Create relationship tables
 	for _, entity := range stateql.Entities {
-		if err := sg.createRelationships(entity); err != nil {
+		if err := sg.createRelationships(tx, entity); err != nil {
+			committer.Rollback()
 			return err
 		}
 	}
 
-	return nil
+	return committer.Commit()
 }
 
-func (sg *SchemaGenerator) createTable(entity parser.Entity) error {
-	// Create base table
-	tableName := strings.ToLower(entity.Name)
-	
+// qualifiedTable returns tableName quoted for this dialect and, on
+// postgres, namespaced under the configured schema. tableName is quoted
+// unconditionally: entity and field names come straight from the StateQL
+// source in an untrusted request body, so even the common no-schema
+// deployment must not interpolate them into DDL unquoted.
+func (sg *SchemaGenerator) qualifiedTable(tableName string) string {
+	quoted := sg.dialect.QuoteIdent(tableName)
+	if sg.schema == "" || sg.dialect.Name() != "postgres" {
+		return quoted
+	}
+	return fmt.Sprintf("%s.%s", sg.dialect.QuoteIdent(sg.schema), quoted)
+}
+
+// buildCreateTableSQL returns the CREATE TABLE statement for entity, plus
+// any supporting statements (the PostGIS extension, GIST indexes) that must
+// run alongside it. It performs no I/O, so planMigration can reuse it to
+// plan statements for an entity that doesn't exist yet without executing
+// anything.
+func (sg *SchemaGenerator) buildCreateTableSQL(entity parser.Entity) ([]string, error) {
+	tableName := sg.qualifiedTable(strings.ToLower(entity.Name))
+
 	// Start building the CREATE TABLE statement
 	createSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (", tableName)
-	
+
 	// Add primary key
-	createSQL += "id SERIAL PRIMARY KEY,"
-	
-	// Add regular fields
+	createSQL += sg.dialect.PrimaryKeyClause() + ","
+
+	// Add regular fields; relationship columns (BelongsTo FK, ManyToMany
+	// junction tables) are added afterwards by buildRelationshipSQL.
+	var geometryColumns []string
 	for _, field := range entity.Fields {
-		if !field.IsMany && !field.IsAction {
-			columnType := mapTypeToPostgres(field.Type)
-			createSQL += fmt.Sprintf("%s %s,", strings.ToLower(field.Name), columnType)
+		if field.IsMany || field.IsAction || field.RelationKind == parser.BelongsTo {
+			continue
 		}
+		columnName := strings.ToLower(field.Name)
+
+		if parser.IsGeometryType(field.Type) {
+			columnType, err := sg.dialect.GeometryColumnSQL(field.Type, field.GeometryArgs)
+			if err != nil {
+				return nil, err
+			}
+			createSQL += fmt.Sprintf("%s %s,", columnName, columnType)
+			geometryColumns = append(geometryColumns, columnName)
+			continue
+		}
+
+		columnType := sg.dialect.MapType(field.Type)
+		createSQL += fmt.Sprintf("%s %s,", columnName, columnType)
 	}
-	
+
 	// Remove trailing comma and close the statement
 	createSQL = strings.TrimSuffix(createSQL, ",") + ")"
-	
-	return sg.db.Exec(createSQL).Error
+
+	var statements []string
+	if len(geometryColumns) > 0 {
+		if extensionSQL := sg.dialect.PostGISExtensionSQL(); extensionSQL != "" {
+			statements = append(statements, extensionSQL)
+		}
+	}
+	statements = append(statements, createSQL)
+	for _, columnName := range geometryColumns {
+		statements = append(statements, sg.dialect.GeometryIndexSQL(tableName, columnName))
+	}
+
+	return statements, nil
 }
 
-func (sg *SchemaGenerator) createRelationships(entity parser.Entity) error {
+func (sg *SchemaGenerator) createTable(tx *gorm.DB, entity parser.Entity) error {
+	statements, err := sg.buildCreateTableSQL(entity)
+	if err != nil {
+		return err
+	}
+	return execAll(tx, statements)
+}
+
+// buildRelationshipSQL returns the statements needed for entity's BelongsTo
+// and ManyToMany fields. HasMany fields need nothing on this side, since
+// their FK column lives on the target entity's BelongsTo field. A
+// ManyToMany pair is declared symmetrically on both entities ("many X thru
+// Y" / "many Y thru X"), so only the canonical side (see
+// isCanonicalManyToMany) emits its junction table here; the other side is a
+// no-op, which is what keeps the two declarations from each building their
+// own unsynchronized copy. Like buildCreateTableSQL, this performs no I/O.
+func (sg *SchemaGenerator) buildRelationshipSQL(entity parser.Entity) []string {
+	var statements []string
 	for _, field := range entity.Fields {
-		if field.IsMany {
-			// Create junction table for many-to-many relationships
-			tableName := fmt.Sprintf("%s_%s", strings.ToLower(entity.Name), strings.ToLower(field.Name))
-			createSQL := fmt.Sprintf(`
-				CREATE TABLE IF NOT EXISTS %s (
-					%s_id INTEGER REFERENCES %s(id),
-					%s_id INTEGER REFERENCES %s(id),
-					PRIMARY KEY (%s_id, %s_id)
-				)`, 
-				tableName,
-				strings.ToLower(entity.Name), strings.ToLower(entity.Name),
-				strings.ToLower(field.Through), strings.ToLower(field.Through),
-				strings.ToLower(entity.Name), strings.ToLower(field.Through))
-			
-			if err := sg.db.Exec(createSQL).Error; err != nil {
-				return err
+		switch field.RelationKind {
+		case parser.BelongsTo:
+			statements = append(statements, sg.buildBelongsToSQL(entity, field)...)
+		case parser.ManyToMany:
+			if isCanonicalManyToMany(entity.Name, field) {
+				statements = append(statements, sg.buildManyToManySQL(entity, field))
 			}
 		}
 	}
-	return nil
+	return statements
 }
 
-func mapTypeToPostgres(stateqlType string) string {
-	switch strings.ToLower(stateqlType) {
-	case "text":
-		return "TEXT"
-	case "number":
-		return "NUMERIC"
-	case "switch":
-		return "BOOLEAN"
-	case "date":
-		return "DATE"
-	case "timestamp":
-		return "TIMESTAMP"
-	case "seconds":
-		return "INTEGER"
-	default:
-		return "TEXT"
+// isCanonicalManyToMany reports whether entityName's side of a "many X thru
+// Y" pair is the one responsible for materializing their shared junction
+// table. The pair is declared on both entities, so without picking a single
+// canonical side each would build its own, unsynchronized copy. The side
+// whose entity name sorts first wins; for a self-referential relation (X
+// thru X) the field name breaks the tie instead.
+func isCanonicalManyToMany(entityName string, field parser.Field) bool {
+	left := strings.ToLower(entityName)
+	right := strings.ToLower(field.Type)
+	if left != right {
+		return left < right
 	}
-} 
\ No newline at end of file
+	return field.Name < field.InverseField
+}
+
+// buildManyToManySQL returns the CREATE TABLE statement for the junction
+// table backing entity's "<field.Name> is many <field.Type> thru
+// <field.Through>" field.
+func (sg *SchemaGenerator) buildManyToManySQL(entity parser.Entity, field parser.Field) string {
+	leftName := strings.ToLower(entity.Name)
+	rightName := strings.ToLower(field.Type)
+	tableName := sg.qualifiedTable(fmt.Sprintf("%s_%s", leftName, strings.ToLower(field.Name)))
+	return sg.dialect.JunctionTableSQL(tableName, leftName, sg.qualifiedTable(leftName), rightName, sg.qualifiedTable(rightName))
+}
+
+func (sg *SchemaGenerator) createRelationships(tx *gorm.DB, entity parser.Entity) error {
+	return execAll(tx, sg.buildRelationshipSQL(entity))
+}
+
+// buildBelongsToSQL returns the statements that add the "<name>_id" foreign
+// key column (and its index) for a "one <Target>" field.
+func (sg *SchemaGenerator) buildBelongsToSQL(entity parser.Entity, field parser.Field) []string {
+	tableName := sg.qualifiedTable(strings.ToLower(entity.Name))
+	columnName := strings.ToLower(field.Name) + "_id"
+	targetTable := sg.qualifiedTable(strings.ToLower(field.Type))
+
+	addColumnSQL := sg.dialect.AddColumnSQL(tableName, columnName, fmt.Sprintf("INTEGER REFERENCES %s(id)", targetTable))
+	indexName := fmt.Sprintf("idx_%s_%s", strings.ToLower(entity.Name), columnName)
+	indexSQL := sg.dialect.IndexSQL(indexName, tableName, columnName)
+
+	return []string{addColumnSQL, indexSQL}
+}
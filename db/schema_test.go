@@ -0,0 +1,118 @@
+package db
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"stateql/parser"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// TestBuildRelationshipSQLManyToMany pins buildRelationshipSQL's
+// canonical-side selection for a symmetric many/thru pair: only the side
+// whose entity name sorts first emits the junction table, so the two
+// entities' declarations converge on one physical table instead of each
+// building their own. It needs no database, since buildRelationshipSQL
+// performs no I/O.
+func TestBuildRelationshipSQLManyToMany(t *testing.T) {
+	stateql, err := parser.ParseStateQL(
+		"Post:\n- tags is many Tag thru posts\n" +
+			"Tag:\n- posts is many Post thru tags\n",
+	)
+	if err != nil {
+		t.Fatalf("failed to parse stateql: %v", err)
+	}
+
+	sg := NewSchemaGenerator(nil, postgresDialect{})
+
+	byName := make(map[string]parser.Entity, len(stateql.Entities))
+	for _, entity := range stateql.Entities {
+		byName[entity.Name] = entity
+	}
+
+	// "Post" sorts before "Tag", so Post's side must build the junction
+	// table and Tag's side must be a no-op.
+	postStatements := sg.buildRelationshipSQL(byName["Post"])
+	if len(postStatements) != 1 {
+		t.Fatalf("expected Post's canonical side to emit 1 statement, got %d: %v", len(postStatements), postStatements)
+	}
+	for _, want := range []string{`"post_tags"`, `"post"(id)`, `"tag"(id)`} {
+		if !strings.Contains(postStatements[0], want) {
+			t.Errorf("Post junction statement = %q, want it to contain %s", postStatements[0], want)
+		}
+	}
+
+	tagStatements := sg.buildRelationshipSQL(byName["Tag"])
+	if len(tagStatements) != 0 {
+		t.Errorf("expected Tag's non-canonical side to emit no statements, got %v", tagStatements)
+	}
+}
+
+// TestSchemaIsolation verifies that two SchemaGenerators configured with
+// different WithSchema namespaces create their tables in separate Postgres
+// schemas, so the same entity name declared by two tenants' StateQL sources
+// never collides and rows inserted under one tenant's schema are invisible
+// to the other's.
+//
+// This exercises real Postgres schema/search_path behavior, so it needs a
+// live database; set STATEQL_TEST_DSN to run it.
+func TestSchemaIsolation(t *testing.T) {
+	dsn := os.Getenv("STATEQL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("STATEQL_TEST_DSN not set; skipping test that requires a live Postgres instance")
+	}
+
+	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	stateql, err := parser.ParseStateQL("Widget:\n- name is text\n")
+	if err != nil {
+		t.Fatalf("failed to parse stateql: %v", err)
+	}
+
+	tenantA := NewSchemaGenerator(database, postgresDialect{}, WithSchema("stateql_test_tenant_a"))
+	tenantB := NewSchemaGenerator(database, postgresDialect{}, WithSchema("stateql_test_tenant_b"))
+	t.Cleanup(func() {
+		database.Exec(`DROP SCHEMA IF EXISTS stateql_test_tenant_a CASCADE`)
+		database.Exec(`DROP SCHEMA IF EXISTS stateql_test_tenant_b CASCADE`)
+	})
+
+	if err := tenantA.GenerateSchema(stateql); err != nil {
+		t.Fatalf("tenant_a GenerateSchema: %v", err)
+	}
+	if err := tenantB.GenerateSchema(stateql); err != nil {
+		t.Fatalf("tenant_b GenerateSchema: %v", err)
+	}
+
+	for _, schema := range []string{"stateql_test_tenant_a", "stateql_test_tenant_b"} {
+		var count int64
+		err := database.Raw(
+			"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'widget'",
+			schema,
+		).Scan(&count).Error
+		if err != nil {
+			t.Fatalf("introspecting %s: %v", schema, err)
+		}
+		if count != 1 {
+			t.Errorf("expected widget table in schema %s, got count %d", schema, count)
+		}
+	}
+
+	if err := database.Exec(`INSERT INTO "stateql_test_tenant_a"."widget" (name) VALUES ('only-in-a')`).Error; err != nil {
+		t.Fatalf("insert into tenant_a.widget: %v", err)
+	}
+
+	var crossTenantCount int64
+	err = database.Raw(`SELECT COUNT(*) FROM "stateql_test_tenant_b"."widget" WHERE name = 'only-in-a'`).Scan(&crossTenantCount).Error
+	if err != nil {
+		t.Fatalf("querying tenant_b.widget: %v", err)
+	}
+	if crossTenantCount != 0 {
+		t.Errorf("expected tenant_b.widget to be isolated from tenant_a, found %d matching rows", crossTenantCount)
+	}
+}
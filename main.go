@@ -1,27 +1,99 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"stateql/db"
 	"stateql/parser"
+	"stateql/scheduler"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
 )
 
+// openDatabase opens a gorm connection and resolves the matching db.Dialect
+// from the DSN scheme (e.g. "postgres://", "mysql://", "sqlserver://") or, for
+// bare key=value conninfo strings with no scheme, defaults to postgres (its
+// native format). Set DATABASE_DRIVER to override.
+func openDatabase(dsn string) (*gorm.DB, db.Dialect, error) {
+	driverName := os.Getenv("DATABASE_DRIVER")
+	if driverName == "" {
+		if idx := strings.Index(dsn, "://"); idx != -1 {
+			driverName = dsn[:idx]
+		} else {
+			// Bare key=value conninfo strings (no scheme) are Postgres's
+			// native format, so that remains the default.
+			driverName = "postgres"
+		}
+	}
+
+	dialect, err := db.DialectForScheme(driverName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var gormDialector gorm.Dialector
+	switch dialect.Name() {
+	case "postgres":
+		gormDialector = postgres.Open(dsn)
+	case "mysql":
+		gormDialector = mysql.Open(dsn)
+	case "sqlite":
+		gormDialector = sqlite.Open(dsn)
+	case "sqlserver":
+		gormDialector = sqlserver.Open(dsn)
+	}
+
+	database, err := gorm.Open(gormDialector, &gorm.Config{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return database, dialect, nil
+}
+
 func main() {
 	// Initialize database connection
-	dsn := "host=localhost user=postgres password=postgres dbname=stateql port=5432 sslmode=disable"
-	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = "host=localhost user=postgres password=postgres dbname=stateql port=5432 sslmode=disable"
+	}
+	database, dialect, err := openDatabase(dsn)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// A default Postgres schema (namespace) can be set for the whole
+	// server via STATEQL_SCHEMA, so that search_path matches the tables
+	// SchemaGenerator creates for the session's connection.
+	defaultSchema := os.Getenv("STATEQL_SCHEMA")
+	var schemaGenOpts []db.SchemaGeneratorOption
+	if defaultSchema != "" {
+		schemaGenOpts = append(schemaGenOpts, db.WithSchema(defaultSchema))
+		if dialect.Name() == "postgres" {
+			setSearchPathSQL := fmt.Sprintf("SET search_path TO %s", defaultSchema)
+			if err := database.Exec(setSearchPathSQL).Error; err != nil {
+				log.Fatal("Failed to set search_path:", err)
+			}
+		}
+	}
+
 	// Initialize schema generator
-	schemaGen := db.NewSchemaGenerator(database)
+	schemaGen := db.NewSchemaGenerator(database, dialect, schemaGenOpts...)
+
+	// Initialize the scheduler for `every=...` action fields and start it
+	// running in the background; jobs are (re)registered below whenever a
+	// schema is applied.
+	sched := scheduler.New(database)
+	sched.Start()
+	defer sched.Stop()
 
 	// Initialize Gin router
 	r := gin.Default()
@@ -30,6 +102,8 @@ func main() {
 	r.POST("/schema", func(c *gin.Context) {
 		var schemaContent struct {
 			Content string `json:"content"`
+			Schema  string `json:"schema"`
+			DryRun  bool   `json:"dry_run"`
 		}
 
 		if err := c.BindJSON(&schemaContent); err != nil {
@@ -44,15 +118,64 @@ func main() {
 			return
 		}
 
-		// Generate database schema
-		if err := schemaGen.GenerateSchema(stateql); err != nil {
+		// A per-request schema override lets multiple StateQL tenants
+		// share one database without a server restart.
+		gen := schemaGen
+		if schemaContent.Schema != "" {
+			gen = db.NewSchemaGenerator(database, dialect, db.WithSchema(schemaContent.Schema))
+		}
+
+		// Migrate the live database to match stateql, applying only the
+		// ADD/ALTER/DROP statements needed to converge. Re-running with the
+		// same content is a no-op. The request's context governs the apply,
+		// so a client disconnect aborts the transaction cleanly.
+		plan, err := gen.Migrate(c.Request.Context(), stateql, schemaContent.Content, schemaContent.DryRun)
+		if err != nil {
 			c.JSON(500, gin.H{"error": "Failed to generate schema: " + err.Error()})
 			return
 		}
 
+		if schemaContent.DryRun {
+			c.JSON(200, gin.H{"dry_run": true, "statements": plan.Statements})
+			return
+		}
+
+		// Register/remove scheduled `every=...` action jobs to match the
+		// newly applied schema.
+		if err := sched.Reconfigure(stateql); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to reconfigure scheduler: " + err.Error()})
+			return
+		}
+
 		c.JSON(200, gin.H{"message": "Schema generated successfully"})
 	})
 
+	// Endpoint to list currently scheduled action jobs
+	r.GET("/scheduler/jobs", func(c *gin.Context) {
+		c.JSON(200, gin.H{"jobs": sched.List()})
+	})
+
+	// Endpoint to run a scheduled action immediately for one row
+	r.POST("/scheduler/run", func(c *gin.Context) {
+		var runRequest struct {
+			Entity string `json:"entity"`
+			Field  string `json:"field"`
+			ID     int64  `json:"id"`
+		}
+
+		if err := c.BindJSON(&runRequest); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		if err := sched.RunNow(runRequest.Entity, runRequest.Field, runRequest.ID); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to run action: " + err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Action run"})
+	})
+
 	// Start the server
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,103 @@
+package parser
+
+import "fmt"
+
+// RelationKind classifies how a Field relates to other entities.
+type RelationKind int
+
+const (
+	Scalar RelationKind = iota
+	BelongsTo
+	HasMany
+	ManyToMany
+)
+
+func (k RelationKind) String() string {
+	switch k {
+	case BelongsTo:
+		return "BelongsTo"
+	case HasMany:
+		return "HasMany"
+	case ManyToMany:
+		return "ManyToMany"
+	default:
+		return "Scalar"
+	}
+}
+
+// resolveRelationships validates every BelongsTo and many/thru field against
+// the rest of stateql and classifies each many/thru field as HasMany or
+// ManyToMany:
+//
+//   - "- author is one User" is always BelongsTo; User must exist.
+//   - "- posts is many Post thru author" is HasMany if Post.author is a
+//     BelongsTo pointing back at this entity.
+//   - it is ManyToMany if Post.author is itself "many <ThisEntity> thru posts",
+//     i.e. the two sides declare a symmetric many/thru pair.
+//   - anything else is a dangling reference and is reported as an error.
+func resolveRelationships(stateql *StateQL) error {
+	entities := make(map[string]*Entity, len(stateql.Entities))
+	for i := range stateql.Entities {
+		entities[stateql.Entities[i].Name] = &stateql.Entities[i]
+	}
+
+	for ei := range stateql.Entities {
+		entity := &stateql.Entities[ei]
+		for fi := range entity.Fields {
+			field := &entity.Fields[fi]
+
+			switch {
+			case field.RelationKind == BelongsTo:
+				if _, ok := entities[field.Type]; !ok {
+					return fmt.Errorf("parser: %s.%s references unknown entity %q", entity.Name, field.Name, field.Type)
+				}
+
+			case field.IsMany:
+				if err := resolveManyField(entities, entity, field); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func resolveManyField(entities map[string]*Entity, entity *Entity, field *Field) error {
+	target, ok := entities[field.Type]
+	if !ok {
+		return fmt.Errorf("parser: %s.%s references unknown entity %q", entity.Name, field.Name, field.Type)
+	}
+	if field.Through == "" {
+		return fmt.Errorf("parser: %s.%s is missing a 'thru' back-reference", entity.Name, field.Name)
+	}
+
+	inverse := findField(target, field.Through)
+	if inverse == nil {
+		return fmt.Errorf("parser: %s.%s thru %q: %s has no field %q", entity.Name, field.Name, field.Through, target.Name, field.Through)
+	}
+
+	switch {
+	case inverse.RelationKind == BelongsTo && inverse.Type == entity.Name:
+		field.RelationKind = HasMany
+		field.InverseField = field.Through
+
+	case inverse.IsMany && inverse.Type == entity.Name && inverse.Through == field.Name:
+		field.RelationKind = ManyToMany
+		field.InverseField = field.Through
+
+	default:
+		return fmt.Errorf("parser: %s.%s thru %q does not point back to %s", entity.Name, field.Name, field.Through, entity.Name)
+	}
+
+	return nil
+}
+
+func findField(entity *Entity, name string) *Field {
+	for i := range entity.Fields {
+		if entity.Fields[i].Name == name {
+			return &entity.Fields[i]
+		}
+	}
+	return nil
+}
@@ -5,11 +5,28 @@ import (
 	"strings"
 )
 
+// GeometryTypes are the StateQL field types backed by PostGIS geometry
+// columns.
+var GeometryTypes = map[string]bool{
+	"point":      true,
+	"polygon":    true,
+	"linestring": true,
+}
+
+// IsGeometryType reports whether stateqlType is a spatial type such as
+// "point", "polygon", or "linestring".
+func IsGeometryType(stateqlType string) bool {
+	return GeometryTypes[strings.ToLower(stateqlType)]
+}
+
 type Field struct {
 	Name           string
 	Type           string
+	GeometryArgs   map[string]string // srid=, dims= modifiers for geometry-typed fields
 	IsMany         bool
 	Through        string
+	RelationKind   RelationKind // Scalar, BelongsTo, HasMany, or ManyToMany; resolved by resolveRelationships
+	InverseField   string       // the matching field name on the target entity, for HasMany/ManyToMany
 	IsAction       bool
 	ActionType     string
 	ActionArgs     map[string]string
@@ -55,6 +72,10 @@ func ParseStateQL(content string) (*StateQL, error) {
 		}
 	}
 
+	if err := resolveRelationships(&stateql); err != nil {
+		return nil, err
+	}
+
 	return &stateql, nil
 }
 
@@ -92,16 +113,26 @@ func parseField(line string) Field {
 		return field
 	}
 
-	// Check if it's a many relationship
+	// Check if it's a one-to-many or many-to-many relationship, e.g.
+	// "many Post thru author"
 	if strings.HasPrefix(typeDef, "many") {
 		field.IsMany = true
-		throughParts := strings.Split(typeDef, " thru ")
+		rest := strings.TrimSpace(strings.TrimPrefix(typeDef, "many"))
+		throughParts := strings.Split(rest, " thru ")
+		field.Type = strings.TrimSpace(throughParts[0])
 		if len(throughParts) == 2 {
 			field.Through = strings.TrimSpace(throughParts[1])
 		}
 		return field
 	}
 
+	// Check if it's a belongs-to relationship, e.g. "one User"
+	if strings.HasPrefix(typeDef, "one ") {
+		field.RelationKind = BelongsTo
+		field.Type = strings.TrimSpace(strings.TrimPrefix(typeDef, "one"))
+		return field
+	}
+
 	// Check if it has a function (thru)
 	if strings.Contains(typeDef, " thru ") {
 		parts := strings.Split(typeDef, " thru ")
@@ -116,36 +147,42 @@ func parseField(line string) Field {
 		return field
 	}
 
-	// Regular field
-	field.Type = typeDef
+	// Regular field, optionally followed by key=value modifiers
+	// (e.g. "polygon srid=4326 dims=2")
+	typeParts := strings.SplitN(typeDef, " ", 2)
+	field.Type = typeParts[0]
+	if IsGeometryType(field.Type) && len(typeParts) == 2 {
+		field.GeometryArgs, _ = parseActionArgs(typeParts[1])
+	}
 	return field
 }
 
 func parseActionArgs(args string) (map[string]string, []string) {
 	result := make(map[string]string)
 	var requiredParams []string
-	
-	// Handle space-separated arguments
-	parts := strings.Fields(args)
+
+	// Handle space-separated arguments; quoted values (e.g. every="0 * * * *")
+	// may themselves contain spaces, so they're tokenized with quotes intact.
+	parts := splitArgs(args)
 	for i := 0; i < len(parts); i++ {
 		part := strings.TrimSpace(parts[i])
-		
+
 		// Handle required parameters (with : prefix)
 		if strings.HasPrefix(part, ":") {
 			paramName := strings.TrimPrefix(part, ":")
 			requiredParams = append(requiredParams, paramName)
 			continue
 		}
-		
+
 		// Handle key=value pairs
 		if strings.Contains(part, "=") {
-			kv := strings.Split(part, "=")
+			kv := strings.SplitN(part, "=", 2)
 			if len(kv) == 2 {
-				result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+				result[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
 			}
 			continue
 		}
-		
+
 		// Handle positional arguments
 		if i == 0 {
 			result["arg1"] = part
@@ -153,10 +190,39 @@ func parseActionArgs(args string) (map[string]string, []string) {
 			result["arg2"] = part
 		}
 	}
-	
+
 	return result, requiredParams
 }
 
+// splitArgs splits a space-separated argument list on whitespace, except
+// inside double-quoted values, so that quoted args like every="0 * * * *"
+// stay intact as a single token.
+func splitArgs(args string) []string {
+	var parts []string
+	var current strings.Builder
+	inQuotes := false
+
+	for _, r := range args {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case r == ' ' && !inQuotes:
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+
+	return parts
+}
+
 func parseFunctionArgs(args string) []string {
 	var result []string
 	parts := strings.Fields(args)
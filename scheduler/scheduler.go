@@ -0,0 +1,173 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"stateql/parser"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// JobInfo describes one registered scheduled action.
+type JobInfo struct {
+	Entity string
+	Field  string
+	Cron   string
+	Scope  string // "global", or "" / "row" for the per-row default
+}
+
+type jobEntry struct {
+	info    JobInfo
+	entryID cron.EntryID
+}
+
+// Scheduler runs StateQL `action ... (every=...)` fields on a cron cadence.
+// Jobs are keyed by entity+field+cron so reconfiguring with the same
+// StateQL source leaves already-running jobs untouched.
+type Scheduler struct {
+	db   *gorm.DB
+	cr   *cron.Cron
+	jobs map[string]jobEntry
+}
+
+// New creates a Scheduler backed by db. Rows for scope=row jobs are looked
+// up by table name directly, since action fields aren't wired to Go handlers
+// yet. Pass cron.Option values (e.g. cron.WithLogger) to customize the
+// underlying cron.Cron.
+func New(db *gorm.DB, opts ...cron.Option) *Scheduler {
+	return &Scheduler{
+		db:   db,
+		cr:   cron.New(opts...),
+		jobs: make(map[string]jobEntry),
+	}
+}
+
+// Start begins running scheduled jobs in the background.
+func (s *Scheduler) Start() {
+	s.cr.Start()
+}
+
+// Stop halts the scheduler, waiting for any running job to finish.
+func (s *Scheduler) Stop() {
+	<-s.cr.Stop().Done()
+}
+
+// List returns every currently registered job.
+func (s *Scheduler) List() []JobInfo {
+	jobs := make([]JobInfo, 0, len(s.jobs))
+	for _, entry := range s.jobs {
+		jobs = append(jobs, entry.info)
+	}
+	return jobs
+}
+
+// Reconfigure registers and removes jobs so the scheduler matches stateql:
+// jobs whose entity+field+cron key is unchanged keep running, new ones are
+// added, and jobs no longer declared are removed.
+func (s *Scheduler) Reconfigure(stateql *parser.StateQL) error {
+	desired := make(map[string]JobInfo)
+
+	for _, entity := range stateql.Entities {
+		for _, field := range entity.Fields {
+			if !field.IsAction {
+				continue
+			}
+			spec := field.ActionArgs["every"]
+			if spec == "" {
+				continue
+			}
+			info := JobInfo{
+				Entity: entity.Name,
+				Field:  field.Name,
+				Cron:   normalizeCronSpec(spec),
+				Scope:  field.ActionArgs["scope"],
+			}
+			desired[jobKey(info.Entity, info.Field, info.Cron)] = info
+		}
+	}
+
+	for key, entry := range s.jobs {
+		if _, ok := desired[key]; !ok {
+			s.cr.Remove(entry.entryID)
+			delete(s.jobs, key)
+		}
+	}
+
+	for key, info := range desired {
+		if _, ok := s.jobs[key]; ok {
+			continue
+		}
+		info := info
+		entryID, err := s.cr.AddFunc(info.Cron, func() { s.run(info) })
+		if err != nil {
+			return fmt.Errorf("scheduler: invalid cron spec %q for %s.%s: %w", info.Cron, info.Entity, info.Field, err)
+		}
+		s.jobs[key] = jobEntry{info: info, entryID: entryID}
+	}
+
+	return nil
+}
+
+// RunNow invokes entity.field's action handler immediately, outside its
+// normal cadence, for the given row id.
+func (s *Scheduler) RunNow(entity, field string, id int64) error {
+	return s.invoke(entity, field, &id)
+}
+
+func (s *Scheduler) run(info JobInfo) {
+	if info.Scope == "global" {
+		if err := s.invoke(info.Entity, info.Field, nil); err != nil {
+			log.Printf("scheduler: %s.%s failed: %v", info.Entity, info.Field, err)
+		}
+		return
+	}
+
+	ids, err := s.rowIDs(info.Entity)
+	if err != nil {
+		log.Printf("scheduler: listing rows for %s failed: %v", info.Entity, err)
+		return
+	}
+	for _, id := range ids {
+		id := id
+		if err := s.invoke(info.Entity, info.Field, &id); err != nil {
+			log.Printf("scheduler: %s.%s (id=%d) failed: %v", info.Entity, info.Field, id, err)
+		}
+	}
+}
+
+func (s *Scheduler) rowIDs(entity string) ([]int64, error) {
+	var ids []int64
+	tableName := strings.ToLower(entity)
+	err := s.db.Raw(fmt.Sprintf("SELECT id FROM %s", tableName)).Scan(&ids).Error
+	return ids, err
+}
+
+// invoke runs entity.field's action handler. StateQL doesn't yet dispatch
+// action fields to real Go functions, so this logs the invocation; it's the
+// seam a future handler registry hooks into.
+func (s *Scheduler) invoke(entity, field string, id *int64) error {
+	if id != nil {
+		log.Printf("scheduler: invoking %s.%s for row %d", entity, field, *id)
+	} else {
+		log.Printf("scheduler: invoking %s.%s (global)", entity, field)
+	}
+	return nil
+}
+
+func jobKey(entity, field, cronSpec string) string {
+	return entity + "." + field + ":" + cronSpec
+}
+
+// normalizeCronSpec accepts either a standard cron expression (e.g.
+// "0 */1 * * *") or a bare duration (e.g. "5m") and returns a spec
+// cron.Cron can parse.
+func normalizeCronSpec(spec string) string {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@") || strings.Contains(spec, " ") {
+		return spec
+	}
+	return "@every " + spec
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"testing"
+
+	"stateql/parser"
+)
+
+// TestReconfigurePreservesUnchangedJobs exercises Reconfigure's stable
+// entity+field+cron keying: it doesn't depend on a job actually firing, so
+// it runs against the scheduler's real (default) cron.Cron rather than a
+// faked clock.
+func TestReconfigurePreservesUnchangedJobs(t *testing.T) {
+	sched := New(nil)
+
+	stateql, err := parser.ParseStateQL("Report:\n- refresh is action thru recompute(every=\"5m\")\n")
+	if err != nil {
+		t.Fatalf("failed to parse stateql: %v", err)
+	}
+
+	if err := sched.Reconfigure(stateql); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	jobs := sched.List()
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(jobs))
+	}
+
+	key := jobKey("Report", "refresh", "@every 5m")
+	firstEntryID := sched.jobs[key].entryID
+
+	// Reconfiguring with the same source must leave the existing job
+	// running rather than removing and recreating it.
+	if err := sched.Reconfigure(stateql); err != nil {
+		t.Fatalf("Reconfigure (repeat): %v", err)
+	}
+	if len(sched.List()) != 1 {
+		t.Fatalf("expected job to survive an unchanged Reconfigure, got %d jobs", len(sched.List()))
+	}
+	if sched.jobs[key].entryID != firstEntryID {
+		t.Errorf("expected the same cron entry to be reused across an unchanged Reconfigure")
+	}
+
+	// Removing the action field from stateql must remove its job.
+	withoutAction, err := parser.ParseStateQL("Report:\n- name is text\n")
+	if err != nil {
+		t.Fatalf("failed to parse stateql: %v", err)
+	}
+	if err := sched.Reconfigure(withoutAction); err != nil {
+		t.Fatalf("Reconfigure (withoutAction): %v", err)
+	}
+	if len(sched.List()) != 0 {
+		t.Errorf("expected job to be removed once its action field is gone, got %d jobs", len(sched.List()))
+	}
+}
+
+func TestNormalizeCronSpec(t *testing.T) {
+	cases := map[string]string{
+		"5m":          "@every 5m",
+		"0 */1 * * *": "0 */1 * * *",
+		"@every 10s":  "@every 10s",
+		" 0 0 * * * ": "0 0 * * *",
+	}
+	for input, want := range cases {
+		if got := normalizeCronSpec(input); got != want {
+			t.Errorf("normalizeCronSpec(%q) = %q, want %q", input, got, want)
+		}
+	}
+}